@@ -21,14 +21,30 @@ import (
 	"os"
 	"strings"
 
+	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 
 	osconfigv1 "github.com/openshift/api/config/v1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	osclientset "github.com/openshift/client-go/config/clientset/versioned"
 	"github.com/openshift/library-go/pkg/config/clusteroperator/v1helpers"
+	corev1 "k8s.io/api/core/v1"
 	k8serrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
+// operandComponents lists the metal3 Deployment containers we report an
+// individual OperandVersion for, in the order they should appear in
+// status messages.
+var operandComponents = []string{
+	"baremetal-operator",
+	"ironic",
+	"ironic-inspector",
+	"ironic-ipa-downloader",
+	"mariadb",
+	"machine-os-images",
+}
+
 // StatusReason is a MixedCaps string representing the reason for a
 // status condition change.
 type StatusReason string
@@ -36,6 +52,10 @@ type StatusReason string
 const (
 	clusterOperatorName = "baremetal"
 
+	// metal3AppName is the name of the Deployment that runs the metal3
+	// containers (baremetal-operator, ironic, and friends).
+	metal3AppName = "metal3"
+
 	// OperatorDisabled represents a Disabled ClusterStatusConditionTypes
 	OperatorDisabled osconfigv1.ClusterStatusConditionType = "Disabled"
 
@@ -49,8 +69,50 @@ const (
 	ReasonSyncFailed StatusReason = "SyncingFailed"
 	// ReasonUnsupported means we have an unsupported platform
 	ReasonUnsupported StatusReason = "UnsupportedPlatform"
+	// ReasonProgressing indicates that the operand is being rolled out
+	ReasonProgressing StatusReason = "Progressing"
+	// ReasonInvalidConfiguration means the Provisioning CR is invalid
+	ReasonInvalidConfiguration StatusReason = "InvalidConfiguration"
+	// ReasonDeployTimedOut means the metal3 deployment did not become
+	// available within the expected time
+	ReasonDeployTimedOut StatusReason = "DeployTimedOut"
+	// ReasonDeploymentCrashLooping means the metal3 deployment's pods are
+	// crash-looping
+	ReasonDeploymentCrashLooping StatusReason = "DeploymentCrashLooping"
+	// ReasonNotFound means an owned resource we expect to exist could not
+	// be found
+	ReasonNotFound StatusReason = "ResourceNotFound"
+	// ReasonManagementStateUnmanaged means the Provisioning CR asked us not
+	// to reconcile owned resources
+	ReasonManagementStateUnmanaged StatusReason = "ManagementStateUnmanaged"
+	// ReasonManagementStateRemoved means the Provisioning CR asked us to
+	// tear down owned resources
+	ReasonManagementStateRemoved StatusReason = "ManagementStateRemoved"
+	// ReasonManagementStateInvalid means the Provisioning CR's
+	// managementState is not one we recognize
+	ReasonManagementStateInvalid StatusReason = "ManagementStateInvalid"
 )
 
+// IsManaged returns true when state means the reconciler should run its
+// normal reconcile loop against owned resources, either because it was
+// explicitly told to (Managed) or told to ignore ownership conflicts
+// while doing so (Force).
+func (r *ProvisioningReconciler) IsManaged(state operatorv1.ManagementState) bool {
+	return state == operatorv1.Managed || state == operatorv1.Force || state == ""
+}
+
+// IsUnmanaged returns true when state means the reconciler must leave
+// owned resources untouched.
+func (r *ProvisioningReconciler) IsUnmanaged(state operatorv1.ManagementState) bool {
+	return state == operatorv1.Unmanaged
+}
+
+// IsRemoved returns true when state means the reconciler should delete
+// owned resources and stop reconciling.
+func (r *ProvisioningReconciler) IsRemoved(state operatorv1.ManagementState) bool {
+	return state == operatorv1.Removed
+}
+
 // defaultStatusConditions returns the default set of status conditions for the
 // ClusterOperator resource used on first creation of the ClusterOperator.
 func defaultStatusConditions() []osconfigv1.ClusterOperatorStatusCondition {
@@ -76,7 +138,10 @@ func relatedObjects() []osconfigv1.ObjectReference {
 }
 
 // createClusterOperator creates the ClusterOperator and updates its status.
-func (r *ProvisioningReconciler) createClusterOperator() (*osconfigv1.ClusterOperator, error) {
+// It is a free function, rather than a method on ProvisioningReconciler, so
+// that UnsupportedPlatformReconciler can share it without depending on the
+// full reconciler.
+func createClusterOperator(osClient osclientset.Interface, log logr.Logger) (*osconfigv1.ClusterOperator, error) {
 	defaultCO := &osconfigv1.ClusterOperator{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ClusterOperator",
@@ -92,22 +157,22 @@ func (r *ProvisioningReconciler) createClusterOperator() (*osconfigv1.ClusterOpe
 	}
 	//operatorv1helpers.SetOperandVersion(&defaultCO.Status.Versions, osconfigv1.OperandVersion{Name: "operator", Version: os.Getenv("RELEASE_VERSION")})
 
-	co, err := r.OSClient.ConfigV1().ClusterOperators().Create(context.Background(), defaultCO, metav1.CreateOptions{})
+	co, err := osClient.ConfigV1().ClusterOperators().Create(context.Background(), defaultCO, metav1.CreateOptions{})
 	if err != nil {
 		return nil, errors.Wrap(err, fmt.Sprintf("failed to create ClusterOperator %s",
 			clusterOperatorName))
 	}
-	r.Log.V(1).Info("created ClusterOperator", "name", clusterOperatorName)
+	log.V(1).Info("created ClusterOperator", "name", clusterOperatorName)
 
 	co.Status = defaultCO.Status
-	return r.OSClient.ConfigV1().ClusterOperators().UpdateStatus(context.Background(), co, metav1.UpdateOptions{})
+	return osClient.ConfigV1().ClusterOperators().UpdateStatus(context.Background(), co, metav1.UpdateOptions{})
 }
 
 // getOrCreateClusterOperator gets the existing CO, failing which it creates a new CO.
-func (r *ProvisioningReconciler) getOrCreateClusterOperator() (*osconfigv1.ClusterOperator, error) {
-	existing, err := r.OSClient.ConfigV1().ClusterOperators().Get(context.Background(), clusterOperatorName, metav1.GetOptions{})
+func getOrCreateClusterOperator(osClient osclientset.Interface, log logr.Logger) (*osconfigv1.ClusterOperator, error) {
+	existing, err := osClient.ConfigV1().ClusterOperators().Get(context.Background(), clusterOperatorName, metav1.GetOptions{})
 	if k8serrors.IsNotFound(err) {
-		return r.createClusterOperator()
+		return createClusterOperator(osClient, log)
 	}
 
 	if err != nil {
@@ -130,7 +195,28 @@ func setStatusCondition(conditionType osconfigv1.ClusterStatusConditionType,
 	}
 }
 
-// getOperandVersions returns the operand version
+// unsupportedPlatformConditions returns the fixed condition set CBO
+// reports on a platform it does not support: Disabled=True,
+// Available=True, Upgradeable=True, with Progressing/Degraded cleared.
+// Both ProvisioningReconciler.updateCOStatus and
+// UnsupportedPlatformReconciler share it so the two reconcilers -
+// which never run at the same time, but do run against the same CO -
+// can't drift on what "unsupported" means.
+func unsupportedPlatformConditions(msg string) []osconfigv1.ClusterOperatorStatusCondition {
+	return []osconfigv1.ClusterOperatorStatusCondition{
+		setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, string(ReasonUnsupported),
+			"Operator is available while being disabled"),
+		setStatusCondition(osconfigv1.OperatorUpgradeable, osconfigv1.ConditionTrue, string(ReasonUnsupported), ""),
+		setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, string(ReasonUnsupported), ""),
+		setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionFalse, string(ReasonUnsupported), ""),
+		setStatusCondition(OperatorDisabled, osconfigv1.ConditionTrue, string(ReasonUnsupported), msg),
+	}
+}
+
+// getOperandVersions returns the "operator" OperandVersion from
+// RELEASE_VERSION, plus one OperandVersion per metal3 component found
+// running in the metal3 Deployment, derived by operandVersion from the
+// pod-template version label or, failing that, the container's image.
 func (r *ProvisioningReconciler) getOperandVersions() []osconfigv1.OperandVersion {
 	operandVersions := []osconfigv1.OperandVersion{}
 	if releaseVersion := os.Getenv("RELEASE_VERSION"); len(releaseVersion) > 0 {
@@ -139,82 +225,254 @@ func (r *ProvisioningReconciler) getOperandVersions() []osconfigv1.OperandVersio
 		err := fmt.Errorf("env variable: RELEASE_VERSION was not set")
 		r.Log.Error(err, "failed to get OperandVersion")
 	}
+
+	deployment, err := r.KubeClient.AppsV1().Deployments(ComponentNamespace).Get(context.Background(), metal3AppName, metav1.GetOptions{})
+	if err != nil {
+		r.Log.Error(err, "failed to get metal3 Deployment while collecting operand versions", "name", metal3AppName)
+		return operandVersions
+	}
+
+	containersByName := map[string]corev1.Container{}
+	for _, container := range deployment.Spec.Template.Spec.Containers {
+		containersByName[container.Name] = container
+	}
+	podLabels := deployment.Spec.Template.Labels
+
+	for _, component := range operandComponents {
+		container, ok := containersByName[component]
+		if !ok {
+			continue
+		}
+		operandVersions = append(operandVersions, osconfigv1.OperandVersion{
+			Name:    component,
+			Version: operandVersion(component, container.Image, podLabels),
+		})
+	}
+
 	return operandVersions
 }
 
-//syncStatus applies the new condition to the CBO ClusterOperator object.
-func (r *ProvisioningReconciler) syncStatus(co *osconfigv1.ClusterOperator, conds []osconfigv1.ClusterOperatorStatusCondition) error {
+// componentVersionLabel is the pod-template label the release payload
+// sets on the metal3 Deployment for a given component, carrying that
+// component's version. Release images are referenced by digest
+// (<registry>/<repo>@sha256:...), which carries no human-readable
+// version on its own, so this label is the authoritative source; the
+// image tag is only a fallback for images that aren't digest-pinned
+// (e.g. in development clusters).
+func componentVersionLabel(component string) string {
+	return "operator.openshift.io/" + component + "-version"
+}
+
+// operandVersion derives component's reported version, preferring the
+// release payload's componentVersionLabel over the container image,
+// since a digest-pinned image has no comparable version of its own.
+func operandVersion(component, image string, podLabels map[string]string) string {
+	if version := podLabels[componentVersionLabel(component)]; version != "" {
+		return version
+	}
+	return operandVersionFromImage(image)
+}
+
+// operandVersionFromImage derives an operand's reported version from its
+// container image reference: the tag after the last ':' of the final path
+// component, or the full reference when the image is pinned purely by
+// digest or carries no tag (a ':' before the last '/' is a registry port).
+func operandVersionFromImage(image string) string {
+	if strings.Contains(image, "@sha256:") {
+		return image
+	}
+	if idx := strings.LastIndex(image, ":"); idx != -1 && idx > strings.LastIndex(image, "/") {
+		return image[idx+1:]
+	}
+	return image
+}
+
+// syncStatus applies the new conditions to the CBO ClusterOperator object.
+func syncStatus(osClient osclientset.Interface, co *osconfigv1.ClusterOperator, conds []osconfigv1.ClusterOperatorStatusCondition) error {
 	for _, c := range conds {
 		v1helpers.SetStatusCondition(&co.Status.Conditions, c)
 	}
 
-	_, err := r.OSClient.ConfigV1().ClusterOperators().UpdateStatus(context.Background(), co, metav1.UpdateOptions{})
+	_, err := osClient.ConfigV1().ClusterOperators().UpdateStatus(context.Background(), co, metav1.UpdateOptions{})
 	return err
 }
 
-// updateCOStatusDisabled updates the ClusterOperator's status to Disabled
-func (r *ProvisioningReconciler) updateCOStatusDisabled() error {
-	disabledMessage := "Operator is non functional"
-	availableMessage := "Operator is available while being disabled"
+// conditions wraps a ClusterOperator's currently-observed conditions and
+// operand versions so status-update call sites can decide whether
+// Progressing should flip without duplicating that logic (and without
+// regressing it) at every call site. In particular it stops Progressing
+// from flapping to True on a transient error while the operand is still
+// serving at the desired version.
+type conditions struct {
+	co *osconfigv1.ClusterOperator
+}
 
-	co, err := r.getOrCreateClusterOperator()
-	if err != nil {
-		r.Log.Error(err, "failed to get or create ClusterOperator")
-		return err
-	}
+func newConditions(co *osconfigv1.ClusterOperator) *conditions {
+	return &conditions{co: co}
+}
 
-	conds := []osconfigv1.ClusterOperatorStatusCondition{
-		setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, string(ReasonUnsupported), availableMessage),
-		setStatusCondition(OperatorDisabled, osconfigv1.ConditionTrue, string(ReasonUnsupported), disabledMessage),
-	}
+// availableIsTrue reports whether the ClusterOperator's Available
+// condition, as last observed, is True.
+func (c *conditions) availableIsTrue() bool {
+	cond := v1helpers.FindStatusCondition(c.co.Status.Conditions, osconfigv1.OperatorAvailable)
+	return cond != nil && cond.Status == osconfigv1.ConditionTrue
+}
 
-	return r.syncStatus(co, conds)
+// progressingIsTrue reports whether the ClusterOperator's Progressing
+// condition, as last observed, is True.
+func (c *conditions) progressingIsTrue() bool {
+	cond := v1helpers.FindStatusCondition(c.co.Status.Conditions, osconfigv1.OperatorProgressing)
+	return cond != nil && cond.Status == osconfigv1.ConditionTrue
 }
 
-// updateCOStatusDegraded updates the ClusterOperator's Degraded
-// degradedReason should contain the current reason for the Operator to be marked in that state
-func (r *ProvisioningReconciler) updateCOStatusDegraded(degradedReason string, detailedError string) error {
-	degradedMessage := "Operator is Degraded"
-	progressingMessage := "Operator is Degraded while Progressing"
+// degradedShouldProgress decides whether a Degraded transition should also
+// set Progressing=True. If the operand is already Available at the
+// versions RELEASE_VERSION expects, the error is transient and we keep
+// Progressing=False rather than flapping the ClusterVersionOperator into
+// "update in progress".
+func (c *conditions) degradedShouldProgress(versionsMatch bool) bool {
+	return !(c.availableIsTrue() && versionsMatch)
+}
 
-	co, err := r.getOrCreateClusterOperator()
-	if err != nil {
-		return err
+// completeShouldProgress decides whether Progressing should stay True once
+// we're able to report Available, so an in-flight upgrade keeps showing as
+// rolling out until the operand versions actually match RELEASE_VERSION.
+func (c *conditions) completeShouldProgress(versionsMatch bool) bool {
+	return c.progressingIsTrue() && !versionsMatch
+}
+
+// operandsAtReleaseVersion reports whether every reported operand version
+// matches RELEASE_VERSION.
+func operandsAtReleaseVersion(versions []osconfigv1.OperandVersion) bool {
+	releaseVersion := os.Getenv("RELEASE_VERSION")
+	if len(releaseVersion) == 0 || len(versions) == 0 {
+		return false
 	}
+	for _, v := range versions {
+		if v.Version != releaseVersion {
+			return false
+		}
+	}
+	return true
+}
 
-	conds := []osconfigv1.ClusterOperatorStatusCondition{
-		setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionTrue, degradedReason, degradedMessage),
-		setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionTrue, detailedError, progressingMessage),
-		setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionFalse, "", ""),
+// laggingOperands returns the names of the operands in versions that have
+// not yet reached RELEASE_VERSION, so a Progressing message can name them.
+func laggingOperands(versions []osconfigv1.OperandVersion) []string {
+	releaseVersion := os.Getenv("RELEASE_VERSION")
+	lagging := []string{}
+	for _, v := range versions {
+		if v.Version != releaseVersion {
+			lagging = append(lagging, v.Name)
+		}
 	}
+	return lagging
+}
 
-	return r.syncStatus(co, conds)
+// conditionStatusFromBool converts b into the corresponding ConditionStatus.
+func conditionStatusFromBool(b bool) osconfigv1.ConditionStatus {
+	if b {
+		return osconfigv1.ConditionTrue
+	}
+	return osconfigv1.ConditionFalse
 }
 
-// updateCOStatusAvailable updates the ClusterOperator's status to Available
-func (r *ProvisioningReconciler) updateCOStatusAvailable() error {
-	co, err := r.getOrCreateClusterOperator()
+// updateCOStatus updates the ClusterOperator's status to reflect newReason,
+// deriving the (Available, Progressing, Degraded, Disabled, Upgradeable)
+// condition tuple from it. msg carries the primary condition's message
+// (Degraded/Available/Disabled, depending on newReason) while progressMsg
+// carries the Progressing condition's message.
+func (r *ProvisioningReconciler) updateCOStatus(newReason StatusReason, msg, progressMsg string) error {
+	co, err := getOrCreateClusterOperator(r.OSClient, r.Log)
 	if err != nil {
+		r.Log.Error(err, "failed to get or create ClusterOperator")
 		return err
 	}
 
-	// Write the operand versions when available
-	co.Status.Versions = r.getOperandVersions()
-
-	versionsOutput := []string{}
-	for _, operand := range co.Status.Versions {
-		versionsOutput = append(versionsOutput, fmt.Sprintf("%s: %s", operand.Name, operand.Version))
-	}
-	versions := strings.Join(versionsOutput, ", ")
-
-	conds := []osconfigv1.ClusterOperatorStatusCondition{
-		setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, string(ReasonEmpty),
-			fmt.Sprintf("Cluster Baremetal Operator is available at %s", versions)),
-		setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, "", ""),
-		setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionFalse, "", ""),
-		setStatusCondition(osconfigv1.OperatorUpgradeable, osconfigv1.ConditionTrue, "", ""),
-		setStatusCondition(OperatorDisabled, osconfigv1.ConditionFalse, "", ""),
+	var conds []osconfigv1.ClusterOperatorStatusCondition
+
+	switch newReason {
+	case ReasonComplete:
+		// Snapshot the pre-update conditions before writing the new operand
+		// versions, so we can tell whether Progressing was already True.
+		cond := newConditions(co)
+		co.Status.Versions = r.getOperandVersions()
+		versionsMatch := operandsAtReleaseVersion(co.Status.Versions)
+
+		versionsOutput := []string{}
+		for _, operand := range co.Status.Versions {
+			versionsOutput = append(versionsOutput, fmt.Sprintf("%s: %s", operand.Name, operand.Version))
+		}
+		versions := strings.Join(versionsOutput, ", ")
+
+		rollingOutProgressMsg := progressMsg
+		if lagging := laggingOperands(co.Status.Versions); len(lagging) > 0 {
+			rollingOutProgressMsg = fmt.Sprintf("Still rolling out the new version of: %s", strings.Join(lagging, ", "))
+		}
+
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, string(newReason),
+				fmt.Sprintf("Cluster Baremetal Operator is available at %s", versions)),
+			setStatusCondition(osconfigv1.OperatorProgressing, conditionStatusFromBool(cond.completeShouldProgress(versionsMatch)), string(newReason), rollingOutProgressMsg),
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionFalse, string(newReason), ""),
+			setStatusCondition(osconfigv1.OperatorUpgradeable, osconfigv1.ConditionTrue, "", ""),
+			setStatusCondition(OperatorDisabled, osconfigv1.ConditionFalse, "", ""),
+		)
+
+	case ReasonSyncing, ReasonProgressing:
+		// Leave Available as-is: the operand may still be serving from a
+		// previous rollout while the new one is in progress.
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionTrue, string(newReason), progressMsg),
+		)
+
+	case ReasonInvalidConfiguration, ReasonDeployTimedOut, ReasonDeploymentCrashLooping, ReasonNotFound:
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionTrue, string(newReason), msg),
+			setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, string(newReason), progressMsg),
+		)
+
+		// Only clobber Available if we don't already have an opinion on it.
+		available := v1helpers.FindStatusCondition(co.Status.Conditions, osconfigv1.OperatorAvailable)
+		if available == nil || available.Status == osconfigv1.ConditionUnknown {
+			conds = append(conds, setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionFalse, string(newReason), msg))
+		}
+
+	case ReasonUnsupported:
+		conds = append(conds, unsupportedPlatformConditions(msg)...)
+
+	case ReasonManagementStateUnmanaged:
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, string(newReason), msg),
+			setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, string(newReason), progressMsg),
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionFalse, string(newReason), ""),
+			setStatusCondition(osconfigv1.OperatorUpgradeable, osconfigv1.ConditionFalse, string(newReason), msg),
+		)
+
+	case ReasonManagementStateRemoved:
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionFalse, string(newReason), msg),
+			setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, string(newReason), progressMsg),
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionFalse, string(newReason), ""),
+		)
+
+	case ReasonManagementStateInvalid:
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionTrue, string(newReason), msg),
+			setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, string(newReason), progressMsg),
+		)
+
+	case ReasonSyncFailed:
+		versionsMatch := operandsAtReleaseVersion(co.Status.Versions)
+		progressing := newConditions(co).degradedShouldProgress(versionsMatch)
+		conds = append(conds,
+			setStatusCondition(osconfigv1.OperatorDegraded, osconfigv1.ConditionTrue, string(newReason), msg),
+			setStatusCondition(osconfigv1.OperatorProgressing, conditionStatusFromBool(progressing), string(newReason), progressMsg),
+		)
+
+	default:
+		return fmt.Errorf("no ClusterOperator status conditions defined for reason: %s", newReason)
 	}
 
-	return r.syncStatus(co, conds)
+	return syncStatus(r.OSClient, co, conds)
 }
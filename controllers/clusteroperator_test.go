@@ -0,0 +1,104 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	osconfigv1 "github.com/openshift/api/config/v1"
+)
+
+func coWithConditions(conds ...osconfigv1.ClusterOperatorStatusCondition) *osconfigv1.ClusterOperator {
+	return &osconfigv1.ClusterOperator{Status: osconfigv1.ClusterOperatorStatus{Conditions: conds}}
+}
+
+func TestDegradedShouldProgress(t *testing.T) {
+	cases := []struct {
+		name          string
+		co            *osconfigv1.ClusterOperator
+		versionsMatch bool
+		want          bool
+	}{
+		{
+			name:          "available and versions match: transient error, don't flap to progressing",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, "", "")),
+			versionsMatch: true,
+			want:          false,
+		},
+		{
+			name:          "available but versions don't match: a rollout is in flight",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionTrue, "", "")),
+			versionsMatch: false,
+			want:          true,
+		},
+		{
+			name:          "not available, versions match",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorAvailable, osconfigv1.ConditionFalse, "", "")),
+			versionsMatch: true,
+			want:          true,
+		},
+		{
+			name:          "Available condition unknown/absent",
+			co:            coWithConditions(),
+			versionsMatch: true,
+			want:          true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newConditions(tc.co).degradedShouldProgress(tc.versionsMatch); got != tc.want {
+				t.Errorf("degradedShouldProgress(%v) = %v, want %v", tc.versionsMatch, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCompleteShouldProgress(t *testing.T) {
+	cases := []struct {
+		name          string
+		co            *osconfigv1.ClusterOperator
+		versionsMatch bool
+		want          bool
+	}{
+		{
+			name:          "progressing and versions now match: rollout finished",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionTrue, "", "")),
+			versionsMatch: true,
+			want:          false,
+		},
+		{
+			name:          "progressing and versions still don't match: rollout still in flight",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionTrue, "", "")),
+			versionsMatch: false,
+			want:          true,
+		},
+		{
+			name:          "not progressing: nothing to keep reporting",
+			co:            coWithConditions(setStatusCondition(osconfigv1.OperatorProgressing, osconfigv1.ConditionFalse, "", "")),
+			versionsMatch: false,
+			want:          false,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := newConditions(tc.co).completeShouldProgress(tc.versionsMatch); got != tc.want {
+				t.Errorf("completeShouldProgress(%v) = %v, want %v", tc.versionsMatch, got, tc.want)
+			}
+		})
+	}
+}
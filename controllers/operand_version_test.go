@@ -0,0 +1,79 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import "testing"
+
+func TestOperandVersionFromImage(t *testing.T) {
+	cases := []struct {
+		name  string
+		image string
+		want  string
+	}{
+		{name: "digest-pinned", image: "quay.io/openshift/origin-ironic@sha256:deadbeef", want: "quay.io/openshift/origin-ironic@sha256:deadbeef"},
+		{name: "tagged", image: "quay.io/openshift/origin-ironic:4.16.0", want: "4.16.0"},
+		{name: "bare image, no tag or digest", image: "quay.io/openshift/origin-ironic", want: "quay.io/openshift/origin-ironic"},
+		{name: "registry host:port with no tag", image: "registry.example.com:5000/openshift/origin-ironic", want: "registry.example.com:5000/openshift/origin-ironic"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := operandVersionFromImage(tc.image); got != tc.want {
+				t.Errorf("operandVersionFromImage(%q) = %q, want %q", tc.image, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestOperandVersion(t *testing.T) {
+	cases := []struct {
+		name      string
+		component string
+		image     string
+		podLabels map[string]string
+		want      string
+	}{
+		{
+			name:      "label present takes precedence over a digest-pinned image",
+			component: "ironic",
+			image:     "quay.io/openshift/origin-ironic@sha256:deadbeef",
+			podLabels: map[string]string{"operator.openshift.io/ironic-version": "4.16.0"},
+			want:      "4.16.0",
+		},
+		{
+			name:      "no label, falls back to the image tag",
+			component: "ironic",
+			image:     "quay.io/openshift/origin-ironic:4.16.0",
+			podLabels: nil,
+			want:      "4.16.0",
+		},
+		{
+			name:      "no label and digest-pinned: unresolved, falls back to the raw image",
+			component: "ironic",
+			image:     "quay.io/openshift/origin-ironic@sha256:deadbeef",
+			podLabels: map[string]string{"operator.openshift.io/mariadb-version": "4.16.0"},
+			want:      "quay.io/openshift/origin-ironic@sha256:deadbeef",
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := operandVersion(tc.component, tc.image, tc.podLabels); got != tc.want {
+				t.Errorf("operandVersion(%q, %q, %v) = %q, want %q", tc.component, tc.image, tc.podLabels, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+
+	metal3iov1alpha1 "github.com/openshift/cluster-baremetal-operator/api/v1alpha1"
+	operatorv1 "github.com/openshift/api/operator/v1"
+	osclientset "github.com/openshift/client-go/config/clientset/versioned"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// ComponentNamespace is the namespace CBO deploys the metal3 stack into.
+const ComponentNamespace = "openshift-machine-api"
+
+// ProvisioningResourceName is the well-known name of the singleton
+// Provisioning CR that configures CBO's operand. main.go also uses it to
+// check whether a Provisioning CR exists at all before deciding to run
+// the full reconciler on the None platform.
+const ProvisioningResourceName = "provisioning-configuration"
+
+// ProvisioningReconciler reconciles a Provisioning object, driving the
+// metal3 Deployment and its supporting resources to match its spec and
+// keeping the baremetal ClusterOperator's status in sync with the result.
+type ProvisioningReconciler struct {
+	Client     client.Client
+	Log        logr.Logger
+	OSClient   osclientset.Interface
+	KubeClient kubernetes.Interface
+
+	// CrashLoopThreshold overrides defaultCrashLoopThreshold for how long
+	// the metal3 Deployment may report unavailable replicas before
+	// resourceStatusAggregator calls it crash-looping. Zero means use the
+	// default.
+	CrashLoopThreshold time.Duration
+}
+
+// Reconcile fetches the Provisioning CR and keeps the baremetal
+// ClusterOperator's status in sync with what happened while doing so,
+// using the reason that matches the actual failure mode rather than a
+// single generic "degraded" bucket.
+func (r *ProvisioningReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	provisioning := &metal3iov1alpha1.Provisioning{}
+	err := r.Client.Get(ctx, client.ObjectKey{Name: ProvisioningResourceName}, provisioning)
+	if k8serrors.IsNotFound(err) {
+		if statusErr := r.updateCOStatus(ReasonNotFound,
+			fmt.Sprintf("Provisioning %q not found", ProvisioningResourceName), ""); statusErr != nil {
+			r.Log.Error(statusErr, "failed to update ClusterOperator status")
+		}
+		return ctrl.Result{}, nil
+	}
+	if err != nil {
+		if statusErr := r.updateCOStatus(ReasonSyncFailed, err.Error(), "Failed while fetching the Provisioning CR"); statusErr != nil {
+			r.Log.Error(statusErr, "failed to update ClusterOperator status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	state := provisioning.Spec.ManagementState
+
+	switch {
+	case r.IsUnmanaged(state):
+		r.Log.Info("managementState is Unmanaged, leaving owned resources untouched")
+		if err := r.updateCOStatus(ReasonManagementStateUnmanaged, "Provisioning.spec.managementState is Unmanaged", ""); err != nil {
+			r.Log.Error(err, "failed to update ClusterOperator status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+
+	case r.IsRemoved(state):
+		if err := r.deleteOwnedResources(ctx); err != nil {
+			if statusErr := r.updateCOStatus(ReasonSyncFailed, err.Error(), "Failed while deleting owned resources"); statusErr != nil {
+				r.Log.Error(statusErr, "failed to update ClusterOperator status")
+			}
+			return ctrl.Result{}, err
+		}
+		if err := r.updateCOStatus(ReasonManagementStateRemoved, "Provisioning.spec.managementState is Removed", ""); err != nil {
+			r.Log.Error(err, "failed to update ClusterOperator status")
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, nil
+
+	case r.IsManaged(state):
+		if err := r.checkExternalOwnership(ctx, state == operatorv1.Force); err != nil {
+			if statusErr := r.updateCOStatus(ReasonInvalidConfiguration, err.Error(), ""); statusErr != nil {
+				r.Log.Error(statusErr, "failed to update ClusterOperator status")
+			}
+			return ctrl.Result{}, err
+		}
+
+	default:
+		if err := r.updateCOStatus(ReasonManagementStateInvalid,
+			fmt.Sprintf("unrecognized managementState %q", state), ""); err != nil {
+			r.Log.Error(err, "failed to update ClusterOperator status")
+		}
+		return ctrl.Result{}, nil
+	}
+
+	reason, msg, progressMsg := r.AggregateResourceStatus(ctx, provisioning)
+	if err := r.updateCOStatus(reason, msg, progressMsg); err != nil {
+		r.Log.Error(err, "failed to update ClusterOperator status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// deleteOwnedResources removes the metal3 Deployment and the ConfigMaps
+// and Services CBO owns, so that a Removed managementState fully tears
+// down the operand rather than merely reporting it absent.
+func (r *ProvisioningReconciler) deleteOwnedResources(ctx context.Context) error {
+	if err := r.KubeClient.AppsV1().Deployments(ComponentNamespace).Delete(ctx, metal3AppName, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete Deployment %q: %w", metal3AppName, err)
+	}
+
+	cmList, err := r.KubeClient.CoreV1().ConfigMaps(ComponentNamespace).List(ctx, metav1.ListOptions{LabelSelector: metal3ResourceSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list owned ConfigMaps: %w", err)
+	}
+	for _, cm := range cmList.Items {
+		if err := r.KubeClient.CoreV1().ConfigMaps(ComponentNamespace).Delete(ctx, cm.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete ConfigMap %q: %w", cm.Name, err)
+		}
+	}
+
+	svcList, err := r.KubeClient.CoreV1().Services(ComponentNamespace).List(ctx, metav1.ListOptions{LabelSelector: metal3ResourceSelector})
+	if err != nil {
+		return fmt.Errorf("failed to list owned Services: %w", err)
+	}
+	for _, svc := range svcList.Items {
+		if err := r.KubeClient.CoreV1().Services(ComponentNamespace).Delete(ctx, svc.Name, metav1.DeleteOptions{}); err != nil && !k8serrors.IsNotFound(err) {
+			return fmt.Errorf("failed to delete Service %q: %w", svc.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkExternalOwnership refuses to reconcile the metal3 Deployment when
+// it already exists under a controller owner CBO didn't set, unless
+// force is true (managementState: Force), which bypasses the check.
+func (r *ProvisioningReconciler) checkExternalOwnership(ctx context.Context, force bool) error {
+	deployment, err := r.KubeClient.AppsV1().Deployments(ComponentNamespace).Get(ctx, metal3AppName, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range deployment.GetOwnerReferences() {
+		if ref.Kind != "Provisioning" && ref.Controller != nil && *ref.Controller {
+			if force {
+				r.Log.Info("managementState is Force, bypassing external-owner check", "deployment", metal3AppName, "owner", ref.Name)
+				return nil
+			}
+			return fmt.Errorf("deployment %q is already controlled by %s/%s; set managementState: Force to override", metal3AppName, ref.Kind, ref.Name)
+		}
+	}
+	return nil
+}
+
+// SetupWithManager registers the controller with mgr.
+func (r *ProvisioningReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&metal3iov1alpha1.Provisioning{}).
+		Complete(r)
+}
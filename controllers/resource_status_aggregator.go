@@ -0,0 +1,170 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metal3iov1alpha1 "github.com/openshift/cluster-baremetal-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// metal3ResourceSelector scopes the Pods/ConfigMaps/Services listed for
+// resourceStatusAggregator to the ones metal3 actually owns, rather than
+// every object in ComponentNamespace.
+const metal3ResourceSelector = "k8s-app=" + metal3AppName
+
+// defaultCrashLoopThreshold is how long the metal3 Deployment may report
+// unavailable replicas before resourceStatusAggregator calls it
+// crash-looping rather than merely still starting up.
+const defaultCrashLoopThreshold = 5 * time.Minute
+
+// resourceStatusAggregator derives a single StatusReason (plus message and
+// progressing message) from the observed state of CBO's owned resources
+// (the metal3 Deployment and its Pods, ConfigMaps, Services) and the
+// Provisioning CR itself. Its Aggregate method returns the first condition
+// it finds, in order from most to least severe.
+type resourceStatusAggregator struct {
+	deployment         *appsv1.Deployment
+	pods               []corev1.Pod
+	configMaps         []corev1.ConfigMap
+	services           []corev1.Service
+	provisioning       *metal3iov1alpha1.Provisioning
+	crashLoopThreshold time.Duration
+}
+
+func newResourceStatusAggregator(deployment *appsv1.Deployment, pods []corev1.Pod, configMaps []corev1.ConfigMap,
+	services []corev1.Service, provisioning *metal3iov1alpha1.Provisioning) *resourceStatusAggregator {
+	return &resourceStatusAggregator{
+		deployment:         deployment,
+		pods:               pods,
+		configMaps:         configMaps,
+		services:           services,
+		provisioning:       provisioning,
+		crashLoopThreshold: defaultCrashLoopThreshold,
+	}
+}
+
+// Aggregate inspects the owned resources and returns the StatusReason that
+// best reflects their combined health, along with the messages to use for
+// the primary and Progressing conditions respectively.
+func (a *resourceStatusAggregator) Aggregate() (reason StatusReason, msg string, progressMsg string) {
+	if a.deployment == nil {
+		return ReasonNotFound, fmt.Sprintf("Deployment %q not found in namespace %q", metal3AppName, ComponentNamespace), ""
+	}
+
+	if since := deploymentUnavailableSince(a.deployment); since != nil && time.Since(*since) > a.crashLoopThreshold {
+		if container, restarting := highestRestartCountContainer(a.pods); restarting {
+			return ReasonDeploymentCrashLooping, fmt.Sprintf("container %q in Deployment %q is restarting repeatedly", container, a.deployment.Name), ""
+		}
+		return ReasonDeployTimedOut, fmt.Sprintf("Deployment %q has not become available", a.deployment.Name), ""
+	}
+
+	if a.deployment.Status.ObservedGeneration < a.deployment.Generation {
+		return ReasonSyncing, "", fmt.Sprintf("Deployment %q has not yet observed its latest spec", a.deployment.Name)
+	}
+
+	if len(a.configMaps) == 0 || len(a.services) == 0 {
+		return ReasonSyncing, "", fmt.Sprintf("Waiting for metal3's ConfigMaps and Services to appear in namespace %q", ComponentNamespace)
+	}
+
+	if a.provisioning != nil && a.provisioning.Status.ObservedGeneration < a.provisioning.Generation {
+		return ReasonSyncing, "", "Provisioning CR has not yet observed its latest spec"
+	}
+
+	return ReasonComplete, "", ""
+}
+
+// deploymentUnavailableSince returns when the Deployment's Available
+// condition most recently flipped to False, or nil if it currently has no
+// unavailable replicas.
+func deploymentUnavailableSince(d *appsv1.Deployment) *time.Time {
+	if d.Status.UnavailableReplicas == 0 {
+		return nil
+	}
+	for _, c := range d.Status.Conditions {
+		if c.Type == appsv1.DeploymentAvailable && c.Status == corev1.ConditionFalse {
+			t := c.LastTransitionTime.Time
+			return &t
+		}
+	}
+	return nil
+}
+
+// highestRestartCountContainer returns the name of the container with the
+// highest restart count across pods, for naming in a crash-loop message.
+// restarting is false when pods is empty or no container has restarted,
+// in which case the Deployment is merely stuck becoming available (e.g.
+// Pending/ImagePullBackOff) rather than crash-looping.
+func highestRestartCountContainer(pods []corev1.Pod) (name string, restarting bool) {
+	var maxRestarts int32
+	for _, pod := range pods {
+		for _, cs := range pod.Status.ContainerStatuses {
+			if cs.RestartCount > maxRestarts {
+				maxRestarts = cs.RestartCount
+				name = cs.Name
+			}
+		}
+	}
+	return name, maxRestarts > 0
+}
+
+// AggregateResourceStatus fetches the metal3 Deployment, and the Pods,
+// ConfigMaps and Services in ComponentNamespace that match
+// metal3ResourceSelector, and takes the Provisioning CR it is given,
+// then reports the StatusReason that best reflects their combined health.
+// It is kept as a thin wrapper around resourceStatusAggregator so tests
+// can exercise Aggregate directly with fake objects instead of a fake
+// clientset.
+func (r *ProvisioningReconciler) AggregateResourceStatus(ctx context.Context, provisioning *metal3iov1alpha1.Provisioning) (StatusReason, string, string) {
+	deployment, err := r.KubeClient.AppsV1().Deployments(ComponentNamespace).Get(ctx, metal3AppName, metav1.GetOptions{})
+	if err != nil {
+		if !k8serrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get metal3 Deployment while aggregating resource status", "name", metal3AppName)
+			return ReasonSyncFailed, err.Error(), ""
+		}
+		deployment = nil
+	}
+
+	podList, err := r.KubeClient.CoreV1().Pods(ComponentNamespace).List(ctx, metav1.ListOptions{LabelSelector: metal3ResourceSelector})
+	if err != nil {
+		r.Log.Error(err, "failed to list metal3 Pods while aggregating resource status")
+		return ReasonSyncFailed, err.Error(), ""
+	}
+
+	cmList, err := r.KubeClient.CoreV1().ConfigMaps(ComponentNamespace).List(ctx, metav1.ListOptions{LabelSelector: metal3ResourceSelector})
+	if err != nil {
+		r.Log.Error(err, "failed to list metal3 ConfigMaps while aggregating resource status")
+		return ReasonSyncFailed, err.Error(), ""
+	}
+
+	svcList, err := r.KubeClient.CoreV1().Services(ComponentNamespace).List(ctx, metav1.ListOptions{LabelSelector: metal3ResourceSelector})
+	if err != nil {
+		r.Log.Error(err, "failed to list metal3 Services while aggregating resource status")
+		return ReasonSyncFailed, err.Error(), ""
+	}
+
+	aggregator := newResourceStatusAggregator(deployment, podList.Items, cmList.Items, svcList.Items, provisioning)
+	if r.CrashLoopThreshold > 0 {
+		aggregator.crashLoopThreshold = r.CrashLoopThreshold
+	}
+	return aggregator.Aggregate()
+}
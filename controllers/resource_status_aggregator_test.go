@@ -0,0 +1,175 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metal3iov1alpha1 "github.com/openshift/cluster-baremetal-operator/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func healthyDeployment() *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: metal3AppName, Generation: 1},
+		Status:     appsv1.DeploymentStatus{ObservedGeneration: 1},
+	}
+}
+
+func TestResourceStatusAggregatorAggregate(t *testing.T) {
+	provisioningUpToDate := &metal3iov1alpha1.Provisioning{
+		ObjectMeta: metav1.ObjectMeta{Generation: 1},
+		Status:     metal3iov1alpha1.ProvisioningStatus{ObservedGeneration: 1},
+	}
+
+	configMaps := []corev1.ConfigMap{{ObjectMeta: metav1.ObjectMeta{Name: "metal3-config"}}}
+	services := []corev1.Service{{ObjectMeta: metav1.ObjectMeta{Name: metal3AppName}}}
+
+	cases := []struct {
+		name       string
+		aggregator *resourceStatusAggregator
+		wantReason StatusReason
+		wantInMsg  string
+	}{
+		{
+			name:       "deployment missing",
+			aggregator: newResourceStatusAggregator(nil, nil, nil, nil, provisioningUpToDate),
+			wantReason: ReasonNotFound,
+			wantInMsg:  metal3AppName,
+		},
+		{
+			name:       "deployment not yet observed its latest spec",
+			aggregator: newResourceStatusAggregator(&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: metal3AppName, Generation: 2}, Status: appsv1.DeploymentStatus{ObservedGeneration: 1}}, nil, configMaps, services, provisioningUpToDate),
+			wantReason: ReasonSyncing,
+		},
+		{
+			name:       "owned ConfigMaps and Services not yet created",
+			aggregator: newResourceStatusAggregator(healthyDeployment(), nil, nil, nil, provisioningUpToDate),
+			wantReason: ReasonSyncing,
+		},
+		{
+			name:       "provisioning not yet observed its latest spec",
+			aggregator: newResourceStatusAggregator(healthyDeployment(), nil, configMaps, services, &metal3iov1alpha1.Provisioning{ObjectMeta: metav1.ObjectMeta{Generation: 2}, Status: metal3iov1alpha1.ProvisioningStatus{ObservedGeneration: 1}}),
+			wantReason: ReasonSyncing,
+		},
+		{
+			name:       "everything healthy",
+			aggregator: newResourceStatusAggregator(healthyDeployment(), nil, configMaps, services, provisioningUpToDate),
+			wantReason: ReasonComplete,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			reason, msg, _ := tc.aggregator.Aggregate()
+			if reason != tc.wantReason {
+				t.Errorf("got reason %q, want %q (msg=%q)", reason, tc.wantReason, msg)
+			}
+			if tc.wantInMsg != "" && !strings.Contains(msg, tc.wantInMsg) {
+				t.Errorf("message %q does not contain %q", msg, tc.wantInMsg)
+			}
+		})
+	}
+}
+
+func TestResourceStatusAggregatorCrashLooping(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: metal3AppName, Generation: 1},
+		Status: appsv1.DeploymentStatus{
+			ObservedGeneration:  1,
+			UnavailableReplicas: 1,
+			Conditions: []appsv1.DeploymentCondition{
+				{
+					Type:               appsv1.DeploymentAvailable,
+					Status:             corev1.ConditionFalse,
+					LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+				},
+			},
+		},
+	}
+	pods := []corev1.Pod{
+		{
+			Status: corev1.PodStatus{
+				ContainerStatuses: []corev1.ContainerStatus{
+					{Name: "ironic", RestartCount: 1},
+					{Name: "baremetal-operator", RestartCount: 7},
+				},
+			},
+		},
+	}
+
+	aggregator := newResourceStatusAggregator(deployment, pods, nil, nil, nil)
+	aggregator.crashLoopThreshold = time.Minute
+
+	reason, msg, _ := aggregator.Aggregate()
+	if reason != ReasonDeploymentCrashLooping {
+		t.Fatalf("got reason %q, want %q", reason, ReasonDeploymentCrashLooping)
+	}
+	if want := "baremetal-operator"; !strings.Contains(msg, want) {
+		t.Errorf("message %q does not name the container with the highest restart count (%q)", msg, want)
+	}
+}
+
+func TestResourceStatusAggregatorUnavailableWithoutRestarts(t *testing.T) {
+	unavailableDeployment := func() *appsv1.Deployment {
+		return &appsv1.Deployment{
+			ObjectMeta: metav1.ObjectMeta{Name: metal3AppName, Generation: 1},
+			Status: appsv1.DeploymentStatus{
+				ObservedGeneration:  1,
+				UnavailableReplicas: 1,
+				Conditions: []appsv1.DeploymentCondition{
+					{
+						Type:               appsv1.DeploymentAvailable,
+						Status:             corev1.ConditionFalse,
+						LastTransitionTime: metav1.NewTime(time.Now().Add(-time.Hour)),
+					},
+				},
+			},
+		}
+	}
+
+	cases := []struct {
+		name string
+		pods []corev1.Pod
+	}{
+		{name: "no pods yet"},
+		{
+			name: "pods present but none have restarted",
+			pods: []corev1.Pod{{Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{
+				{Name: "ironic", RestartCount: 0},
+			}}}},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			aggregator := newResourceStatusAggregator(unavailableDeployment(), tc.pods, nil, nil, nil)
+			aggregator.crashLoopThreshold = time.Minute
+
+			reason, msg, _ := aggregator.Aggregate()
+			if reason != ReasonDeployTimedOut {
+				t.Fatalf("got reason %q, want %q (msg=%q)", reason, ReasonDeployTimedOut, msg)
+			}
+			if strings.Contains(msg, `""`) {
+				t.Errorf("message %q contains an empty container name placeholder", msg)
+			}
+		})
+	}
+}
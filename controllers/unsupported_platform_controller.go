@@ -0,0 +1,74 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/go-logr/logr"
+
+	osconfigv1 "github.com/openshift/api/config/v1"
+	osclientset "github.com/openshift/client-go/config/clientset/versioned"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+)
+
+// UnsupportedPlatformReconciler keeps the baremetal ClusterOperator
+// reporting Disabled=True/Available=True/Upgradeable=True on platforms
+// this operator does not support. main.go registers either this
+// reconciler or ProvisioningReconciler at startup, based on the cluster's
+// Infrastructure platform, but never both.
+type UnsupportedPlatformReconciler struct {
+	Log      logr.Logger
+	OSClient osclientset.Interface
+}
+
+// Reconcile brings the baremetal ClusterOperator's status back in line
+// with the "unsupported platform" reasons; it does not look at its
+// request argument because there is nothing else for it to reconcile.
+func (r *UnsupportedPlatformReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	if err := r.updateCOStatus(); err != nil {
+		r.Log.Error(err, "unable to update ClusterOperator status")
+		return ctrl.Result{}, err
+	}
+	return ctrl.Result{}, nil
+}
+
+// updateCOStatus reports the fixed Disabled/Available/Upgradeable tuple
+// for an unsupported platform. It shares unsupportedPlatformConditions
+// with ProvisioningReconciler.updateCOStatus's ReasonUnsupported case so
+// the two reconcilers can't independently drift on what "unsupported"
+// means.
+func (r *UnsupportedPlatformReconciler) updateCOStatus() error {
+	co, err := getOrCreateClusterOperator(r.OSClient, r.Log)
+	if err != nil {
+		r.Log.Error(err, "failed to get or create ClusterOperator")
+		return err
+	}
+
+	return syncStatus(r.OSClient, co, unsupportedPlatformConditions("Operator is non functional"))
+}
+
+// SetupWithManager registers the controller with mgr, watching the
+// cluster's Infrastructure object purely to pick up a create event at
+// startup; the platform it reports on does not change over the life of
+// the cluster.
+func (r *UnsupportedPlatformReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&osconfigv1.Infrastructure{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Complete(r)
+}
@@ -0,0 +1,157 @@
+/*
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/openshift/cluster-baremetal-operator/controllers"
+
+	metal3iov1alpha1 "github.com/openshift/cluster-baremetal-operator/api/v1alpha1"
+	osconfigv1 "github.com/openshift/api/config/v1"
+	osclientset "github.com/openshift/client-go/config/clientset/versioned"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+)
+
+const infrastructureResourceName = "cluster"
+
+// alwaysSupportedPlatforms lists the Infrastructure platform types CBO
+// always runs its full reconcile loop against. NonePlatformType is
+// supported too, but only once a Provisioning CR actually exists (see
+// noneWithProvisioning) — a None-platform cluster with no baremetal
+// intent should get UnsupportedPlatformReconciler instead, the same as
+// every other unlisted platform.
+var alwaysSupportedPlatforms = map[osconfigv1.PlatformType]bool{
+	osconfigv1.BareMetalPlatformType: true,
+}
+
+func main() {
+	opts := zap.Options{}
+	opts.BindFlags(flag.CommandLine)
+	flag.Parse()
+	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
+
+	cfg := ctrl.GetConfigOrDie()
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{})
+	if err != nil {
+		setupFail("unable to start manager", err)
+	}
+
+	osClient, err := osclientset.NewForConfig(cfg)
+	if err != nil {
+		setupFail("unable to create openshift config client", err)
+	}
+
+	platform, err := getPlatform(osClient)
+	if err != nil {
+		setupFail("unable to determine the cluster's platform", err)
+	}
+
+	log := ctrl.Log.WithName("setup")
+	log.Info("detected cluster platform", "platform", platform)
+
+	supported := alwaysSupportedPlatforms[platform]
+	if platform == osconfigv1.NonePlatformType {
+		supported, err = noneWithProvisioning(cfg)
+		if err != nil {
+			setupFail("unable to determine whether a Provisioning CR exists", err)
+		}
+	}
+
+	if !supported {
+		reconciler := &controllers.UnsupportedPlatformReconciler{
+			Log:      ctrl.Log.WithName("controllers").WithName("UnsupportedPlatform"),
+			OSClient: osClient,
+		}
+		if err := reconciler.SetupWithManager(mgr); err != nil {
+			setupFail("unable to create UnsupportedPlatform controller", err)
+		}
+	} else {
+		kubeClient, err := kubernetes.NewForConfig(cfg)
+		if err != nil {
+			setupFail("unable to create kube client", err)
+		}
+
+		reconciler := &controllers.ProvisioningReconciler{
+			Client:     mgr.GetClient(),
+			Log:        ctrl.Log.WithName("controllers").WithName("Provisioning"),
+			OSClient:   osClient,
+			KubeClient: kubeClient,
+		}
+		if err := reconciler.SetupWithManager(mgr); err != nil {
+			setupFail("unable to create Provisioning controller", err)
+		}
+	}
+
+	log.Info("starting manager")
+	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
+		setupFail("problem running manager", err)
+	}
+}
+
+// noneWithProvisioning reports whether the singleton Provisioning CR
+// exists, which on the None platform is what distinguishes a cluster
+// that wants CBO's operand from one with no baremetal intent at all. It
+// reads directly rather than through the manager's client because the
+// manager's cache isn't started yet at this point in main.
+func noneWithProvisioning(cfg *rest.Config) (bool, error) {
+	scheme := runtime.NewScheme()
+	if err := metal3iov1alpha1.AddToScheme(scheme); err != nil {
+		return false, err
+	}
+	c, err := client.New(cfg, client.Options{Scheme: scheme})
+	if err != nil {
+		return false, err
+	}
+
+	provisioning := &metal3iov1alpha1.Provisioning{}
+	err = c.Get(context.Background(), client.ObjectKey{Name: controllers.ProvisioningResourceName}, provisioning)
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// getPlatform returns the cluster's platform type from the singleton
+// Infrastructure object.
+func getPlatform(osClient osclientset.Interface) (osconfigv1.PlatformType, error) {
+	infra, err := osClient.ConfigV1().Infrastructures().Get(context.Background(), infrastructureResourceName, metav1.GetOptions{})
+	if err != nil {
+		return "", err
+	}
+	if infra.Status.PlatformStatus == nil {
+		return "", fmt.Errorf("infrastructure %q has no platformStatus set", infrastructureResourceName)
+	}
+	return infra.Status.PlatformStatus.Type, nil
+}
+
+func setupFail(msg string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %v\n", msg, err)
+	os.Exit(1)
+}